@@ -24,17 +24,29 @@ func main() {
 		configDir       string
 		hostsConfigFile string
 		verbose         bool
+		apply           bool
+		dryRun          bool
+		rollback        bool
+		verify          bool
 	)
 
 	flag.StringVar(&configDir, "config-dir", "config", "directory storing host mapping ('host_config.yaml') and *.nmconnection files per host")
 	flag.StringVar(&hostsConfigFile, "hosts-config-file", "host_config.yaml", "name of the hosts config file mapping interfaces to the respective MAC addresses")
 	flag.BoolVar(&verbose, "verbose", false, "enables DEBUG log level")
+	flag.BoolVar(&apply, "apply", false, "reload NetworkManager and activate the written connections over D-Bus")
+	flag.BoolVar(&dryRun, "dry-run", false, "print the diff against the existing on-disk keyfiles without writing or applying anything")
+	flag.BoolVar(&rollback, "rollback", false, "restore the most recent backup snapshot and reload NetworkManager, instead of writing any new files")
+	flag.BoolVar(&verify, "verify", false, "run the host's post-apply health checks and roll back automatically if any fails; requires -apply")
 	flag.Parse()
 
 	if verbose {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	if verify && !apply {
+		log.Fatal("-verify requires -apply")
+	}
+
 	if err := os.MkdirAll(systemConnectionsDir, 0755); err != nil {
 		log.Fatalf("failed to create \"system-connections\" dir: %s", err)
 	}
@@ -49,8 +61,8 @@ func main() {
 		log.Fatalf("failed to load system network interfaces: %s", err)
 	}
 
-	c := configurator.New(conf, networkInterfaces)
-	if err = c.Run(); err != nil {
+	c := configurator.New(conf, networkInterfaces, configurator.GetDMIInfo())
+	if err = c.Run(configurator.RunOptions{Apply: apply, DryRun: dryRun, Rollback: rollback, Verify: verify}); err != nil {
 		log.Fatalf("failed to configure network manager: %s", err)
 	}
 	log.Info("successfully configured network manager")
@@ -33,15 +33,18 @@ func TestConfigurator(t *testing.T) {
 	conf, err := config.Load(sourceDir, configFile, destDir)
 	require.Nil(t, err)
 
-	networkInterfaces := map[string]string{
-		"00:11:22:33:44:55": "eth0",
-		"00:11:22:33:44:56": "eth0.202", // Defined as "eth0.101" in eth0.101.nmconnection
-		"00:11:22:33:44:57": "eth1",
-		//"00:11:22:33:44:58": "bond0", Excluded on purpose, "bond0.nmconnection" should still be copied
+	networkInterfaces := configurator.NetworkInterfaces{
+		{Name: "eth0", MAC: "00:11:22:33:44:55"},
+		{Name: "eth0.202", MAC: "00:11:22:33:44:56"}, // Defined as "eth0.101" in eth0.101.nmconnection
+		{Name: "eth1", MAC: "00:11:22:33:44:57"},
+		//{Name: "bond0", MAC: "00:11:22:33:44:58"}, Excluded on purpose, "bond0.nmconnection" should still be copied
 	}
 
-	c := configurator.New(conf, networkInterfaces)
-	require.NoError(t, c.Run())
+	c := configurator.New(conf, networkInterfaces, nil)
+	require.NoError(t, c.Run(configurator.RunOptions{
+		LockFilePath:  filepath.Join(t.TempDir(), "nm-configurator.lock"),
+		BackupRootDir: t.TempDir(),
+	}))
 
 	// Verify the content of the copied files.
 	hostDir := filepath.Join(sourceDir, "node1.example.com")
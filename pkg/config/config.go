@@ -21,19 +21,71 @@ type Config struct {
 type Host struct {
 	Name       string       `yaml:"hostname"`
 	Interfaces []*Interface `yaml:"interfaces"`
+	// DMI holds optional DMI/SMBIOS selectors used to identify this host
+	// independently of its network interfaces, e.g. on cloned golden images.
+	DMI *DMISelectors `yaml:"dmi,omitempty"`
+	// Verify holds the optional post-apply health checks run for this host
+	// when Run is invoked with RunOptions.Verify.
+	Verify *VerifyConfig `yaml:"verify,omitempty"`
 }
 
 func (h *Host) String() string {
 	return fmt.Sprintf("{Name: %s Interfaces: %+v}", h.Name, h.Interfaces)
 }
 
+// DMISelectors are optional DMI/SMBIOS fields read from
+// "/sys/class/dmi/id/*" used to identify a host.
+type DMISelectors struct {
+	SystemUUID      string `yaml:"system_uuid,omitempty"`
+	ProductSerial   string `yaml:"product_serial,omitempty"`
+	ChassisAssetTag string `yaml:"chassis_asset_tag,omitempty"`
+}
+
+func (d *DMISelectors) String() string {
+	return fmt.Sprintf("{SystemUUID: %s ProductSerial: %s ChassisAssetTag: %s}", d.SystemUUID, d.ProductSerial, d.ChassisAssetTag)
+}
+
 type Interface struct {
 	LogicalName string `yaml:"logical_name"`
 	MACAddress  string `yaml:"mac_address"`
+	// PCIAddress, DevicePath, Driver and PortName are optional additional
+	// selectors used to identify the physical port when the MAC address is
+	// unstable or ambiguous, e.g. bonded NICs, MAC-randomized VFs or cloned
+	// golden images.
+	PCIAddress string `yaml:"pci_address,omitempty"`
+	DevicePath string `yaml:"device_path,omitempty"`
+	Driver     string `yaml:"driver,omitempty"`
+	PortName   string `yaml:"port_name,omitempty"`
 }
 
 func (i *Interface) String() string {
-	return fmt.Sprintf("{LogicalName: %s MACAddress: %s}", i.LogicalName, i.MACAddress)
+	return fmt.Sprintf("{LogicalName: %s MACAddress: %s PCIAddress: %s DevicePath: %s Driver: %s PortName: %s}",
+		i.LogicalName, i.MACAddress, i.PCIAddress, i.DevicePath, i.Driver, i.PortName)
+}
+
+// VerifyConfig describes the post-apply health checks run for a host after
+// its connections have been activated.
+type VerifyConfig struct {
+	// Timeout bounds how long the checks are retried before giving up, e.g.
+	// "30s". Defaults to 30s when empty.
+	Timeout string `yaml:"timeout,omitempty"`
+	// DefaultRouteInterface, if set, checks that the default route is
+	// present and points at this interface.
+	DefaultRouteInterface string `yaml:"default_route_interface,omitempty"`
+	// DNSHostname, if set, checks that this hostname resolves.
+	DNSHostname string `yaml:"dns_hostname,omitempty"`
+	// Targets are additional reachability checks, e.g. a ping or TCP-connect
+	// to a gateway or upstream service.
+	Targets []VerifyTarget `yaml:"targets,omitempty"`
+}
+
+// VerifyTarget is a single reachability check of a VerifyConfig.
+type VerifyTarget struct {
+	// Type is "ping" or "tcp".
+	Type    string `yaml:"type"`
+	Address string `yaml:"address"`
+	// Port is required for Type "tcp".
+	Port int `yaml:"port,omitempty"`
 }
 
 func Load(sourceDir, configFilename, destinationDir string) (*Config, error) {
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// NetworkStateFilename is the name of the optional declarative, nmstate-style
+// network configuration document stored inside a host's directory. When
+// present it is used instead of pre-baked *.nmconnection keyfiles.
+const NetworkStateFilename = "network-state.yaml"
+
+// InterfaceType identifies the kind of network interface a DesiredInterface
+// describes, mirroring the subset of nmstate interface types this renderer
+// understands.
+type InterfaceType string
+
+const (
+	InterfaceTypeEthernet  InterfaceType = "ethernet"
+	InterfaceTypeVlan      InterfaceType = "vlan"
+	InterfaceTypeBond      InterfaceType = "bond"
+	InterfaceTypeBridge    InterfaceType = "bridge"
+	InterfaceTypeOVSBridge InterfaceType = "ovs-bridge"
+)
+
+// NetworkState is the root of a declarative, nmstate-style desired state
+// document for a single host.
+type NetworkState struct {
+	Interfaces []*DesiredInterface `yaml:"interfaces"`
+}
+
+// DesiredInterface describes the desired configuration of a single network
+// interface, analogous to one entry of nmstate's "interfaces:" list.
+type DesiredInterface struct {
+	Name            string           `yaml:"name"`
+	Type            InterfaceType    `yaml:"type"`
+	State           string           `yaml:"state,omitempty"`
+	MACAddress      string           `yaml:"mac-address,omitempty"`
+	IPv4            *IPConfig        `yaml:"ipv4,omitempty"`
+	IPv6            *IPConfig        `yaml:"ipv6,omitempty"`
+	LinkAggregation *LinkAggregation `yaml:"link-aggregation,omitempty"`
+	Vlan            *VlanConfig      `yaml:"vlan,omitempty"`
+	Bridge          *BridgeConfig    `yaml:"bridge,omitempty"`
+}
+
+// IPConfig is the "ipv4"/"ipv6" addressing block of a DesiredInterface.
+type IPConfig struct {
+	Enabled bool        `yaml:"enabled"`
+	DHCP    bool        `yaml:"dhcp,omitempty"`
+	Address []IPAddress `yaml:"address,omitempty"`
+}
+
+// IPAddress is a single static address entry of an IPConfig.
+type IPAddress struct {
+	IP           string `yaml:"ip"`
+	PrefixLength int    `yaml:"prefix-length"`
+}
+
+// LinkAggregation is the "link-aggregation" block of a bond interface.
+type LinkAggregation struct {
+	Mode string   `yaml:"mode"`
+	Port []string `yaml:"port"`
+	// Options holds additional bond options beyond Mode (e.g. "miimon",
+	// "primary"), each rendered as its own key under the connection's
+	// "[bond]" section.
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// VlanConfig is the "vlan" block of a vlan interface.
+type VlanConfig struct {
+	ID        uint32 `yaml:"id"`
+	BaseIface string `yaml:"base-iface"`
+}
+
+// BridgeConfig is the "bridge" block of a bridge/ovs-bridge interface.
+type BridgeConfig struct {
+	Port []BridgePort `yaml:"port"`
+}
+
+// BridgePort is a single port entry of a BridgeConfig.
+type BridgePort struct {
+	Name string `yaml:"name"`
+}
+
+// LoadNetworkState reads the declarative network-state.yaml document for the
+// given host directory, if one exists. It returns (nil, nil) when the file
+// is absent so callers can fall back to pre-baked *.nmconnection keyfiles.
+func LoadNetworkState(hostDir string) (*NetworkState, error) {
+	file, err := os.ReadFile(filepath.Join(hostDir, NetworkStateFilename))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state NetworkState
+	if err = yaml.Unmarshal(file, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
@@ -1,68 +1,518 @@
 package configurator
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/suse-edge/nm-configurator/pkg/config"
+	"github.com/suse-edge/nm-configurator/pkg/nmclient"
+	"github.com/suse-edge/nm-configurator/pkg/renderer"
 	"gopkg.in/ini.v1"
 )
 
 const connectionFileExt = ".nmconnection"
 
+// activationTimeout bounds how long Run waits for a connection to reach the
+// "activated" device state when run with RunOptions.Apply.
+const activationTimeout = 60 * time.Second
+
 type Configurator struct {
 	config            *config.Config
 	networkInterfaces NetworkInterfaces
+	localDMI          *DMIInfo
 }
 
-func New(config *config.Config, interfaces NetworkInterfaces) *Configurator {
+func New(config *config.Config, interfaces NetworkInterfaces, dmi *DMIInfo) *Configurator {
 	return &Configurator{
 		config:            config,
 		networkInterfaces: interfaces,
+		localDMI:          dmi,
 	}
 }
 
-func (c *Configurator) Run() error {
+// RunOptions controls the optional NetworkManager integration performed by
+// Run after the *.nmconnection files have been prepared.
+type RunOptions struct {
+	// Apply reloads NetworkManager and activates the rendered connections
+	// over D-Bus instead of leaving that to the operator.
+	Apply bool
+	// DryRun computes and prints the per-section, per-key diff between the
+	// existing on-disk keyfile and the one that would be written, without
+	// touching disk or NetworkManager.
+	DryRun bool
+	// Rollback restores the most recent backup snapshot of the destination
+	// dir and reloads NetworkManager, instead of writing any new files.
+	Rollback bool
+	// Verify runs the host's configured post-apply health checks after
+	// activation and, if any fails, restores the previous snapshot and
+	// reloads NetworkManager. Only meaningful together with Apply.
+	Verify bool
+	// LockFilePath overrides the path of the cross-process lock acquired for
+	// the duration of any mutating run. Defaults to "/run/nm-configurator.lock".
+	// Intended for tests; production callers should leave this empty.
+	LockFilePath string
+	// BackupRootDir overrides the directory storing timestamped snapshots of
+	// the destination dir. Defaults to "/var/lib/nm-configurator/backup".
+	// Intended for tests; production callers should leave this empty.
+	BackupRootDir string
+}
+
+func (c *Configurator) Run(opts RunOptions) error {
+	lockFilePath := defaultLockFilePath
+	if opts.LockFilePath != "" {
+		lockFilePath = opts.LockFilePath
+	}
+
+	backupRootDir := defaultBackupRootDir
+	if opts.BackupRootDir != "" {
+		backupRootDir = opts.BackupRootDir
+	}
+
+	if opts.Rollback {
+		lock, err := acquireLock(lockFilePath)
+		if err != nil {
+			return fmt.Errorf("acquiring lock: %w", err)
+		}
+		defer func() {
+			if err := lock.release(); err != nil {
+				log.Warnf("failed to release lock %s: %s", lockFilePath, err)
+			}
+		}()
+
+		return c.rollback(backupRootDir)
+	}
+
 	host, err := c.identifyHost()
 	if err != nil {
 		return fmt.Errorf("identifying host: %w", err)
 	}
 	log.Infof("successfully identified host: %s", host.Name)
 
-	if err = c.copyConnectionFiles(host); err != nil {
-		return fmt.Errorf("copying files: %w", err)
+	hostConfigDir := filepath.Join(c.config.SourceDir, host.Name)
+
+	state, err := config.LoadNetworkState(hostConfigDir)
+	if err != nil {
+		return fmt.Errorf("loading declarative network state: %w", err)
+	}
+
+	var (
+		files     map[string]*ini.File
+		prepErr   error
+		errPrefix string
+	)
+
+	if state != nil {
+		log.Infof("rendering declarative network state for host: %s", host.Name)
+		files, prepErr = c.prepareRenderedFiles(host, state)
+		errPrefix = "rendering files"
+	} else {
+		files, prepErr = c.prepareConnectionFiles(host)
+		errPrefix = "copying files"
+	}
+
+	if prepErr != nil && files == nil {
+		return fmt.Errorf("%s: %w", errPrefix, prepErr)
+	}
+
+	if opts.DryRun {
+		if err = c.printDiff(files); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
+		if prepErr != nil {
+			return fmt.Errorf("%s: %w", errPrefix, prepErr)
+		}
+		return nil
+	}
+
+	// Only the mutating path below needs to serialize against overlapping
+	// invocations; a dry-run never touches disk or NetworkManager.
+	lock, err := acquireLock(lockFilePath)
+	if err != nil {
+		return fmt.Errorf("acquiring lock: %w", err)
+	}
+	defer func() {
+		if err := lock.release(); err != nil {
+			log.Warnf("failed to release lock %s: %s", lockFilePath, err)
+		}
+	}()
+
+	backupDir, err := snapshotDestinationDir(c.config.DestinationDir, backupRootDir)
+	if err != nil {
+		return fmt.Errorf("snapshotting destination dir: %w", err)
+	}
+
+	writeErr := errors.Join(prepErr, c.writeConnectionFiles(files))
+
+	var applyErr, verifyErr error
+	if writeErr == nil && opts.Apply {
+		applyErr = c.applyConnections(files)
+
+		if applyErr == nil && opts.Verify {
+			log.Infof("running post-apply health checks for host: %s", host.Name)
+			verifyErr = c.runHealthChecks(host)
+		}
+	}
+
+	if batchErr := errors.Join(writeErr, applyErr, verifyErr); batchErr != nil {
+		if backupDir != "" {
+			log.Warnf("rolling back %s due to error: %s", c.config.DestinationDir, batchErr)
+			if err = restoreSnapshot(c.config.DestinationDir, backupDir); err != nil {
+				log.Errorf("failed to restore snapshot %s: %s", backupDir, err)
+			} else if client, clientErr := nmclient.New(); clientErr == nil {
+				if err = client.ReloadConnections(); err != nil {
+					log.Errorf("failed to reload NetworkManager after rollback: %s", err)
+				}
+				_ = client.Close()
+			}
+		}
+
+		switch {
+		case writeErr != nil:
+			return fmt.Errorf("%s: %w", errPrefix, writeErr)
+		case applyErr != nil:
+			return fmt.Errorf("applying connections: %w", applyErr)
+		default:
+			return fmt.Errorf("verifying: %w", verifyErr)
+		}
+	}
+
+	return nil
+}
+
+// rollback restores the newest backup snapshot under backupRootDir of the
+// destination dir and asks NetworkManager to reload it.
+func (c *Configurator) rollback(backupRootDir string) error {
+	backupDir, err := newestSnapshot(backupRootDir)
+	if err != nil {
+		return fmt.Errorf("finding latest backup: %w", err)
+	}
+
+	log.Infof("restoring backup %s...", backupDir)
+	if err = restoreSnapshot(c.config.DestinationDir, backupDir); err != nil {
+		return fmt.Errorf("restoring backup %s: %w", backupDir, err)
+	}
+
+	client, err := nmclient.New()
+	if err != nil {
+		return fmt.Errorf("connecting to NetworkManager: %w", err)
+	}
+	defer client.Close()
+
+	if err = client.ReloadConnections(); err != nil {
+		return fmt.Errorf("reloading connections: %w", err)
+	}
+
+	return nil
+}
+
+// prepareRenderedFiles renders the host's declarative network state into
+// *.nmconnection files, keyed by their destination path, used as an
+// alternative to pre-baked keyfiles under prepareConnectionFiles.
+func (c *Configurator) prepareRenderedFiles(host *config.Host, state *config.NetworkState) (map[string]*ini.File, error) {
+	rendered, err := renderer.Render(host.Name, state)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*ini.File, len(rendered))
+	for name, file := range rendered {
+		files[filepath.Join(c.config.DestinationDir, name)] = file
+	}
+
+	return files, nil
+}
+
+// writeConnectionFiles stores each file at its destination path. Every file
+// is first written to a temporary file in the same directory, fsync'd and
+// chmod'd, then renamed into place atomically, so a crash or a failure
+// partway through the batch never leaves a destination file truncated or
+// half-written.
+func (c *Configurator) writeConnectionFiles(files map[string]*ini.File) error {
+	var errs []error
+
+	for destination, file := range files {
+		log.Infof("storing file %s...", destination)
+		if err := writeFileAtomically(destination, file); err != nil {
+			errs = append(errs, fmt.Errorf("storing file %s: %w", destination, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeFileAtomically stages file's contents in a temp file next to
+// destination, then renames it into place so readers never observe a
+// partially-written file.
+func writeFileAtomically(destination string, file *ini.File) error {
+	tmp, err := os.CreateTemp(filepath.Dir(destination), ".nm-configurator-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once the rename below succeeds
+
+	if _, err = file.WriteTo(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	// Set the necessary permissions required by NetworkManager.
+	if err = os.Chmod(tmpPath, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, destination)
+}
+
+// printDiff prints, per destination, the per-section per-key differences
+// between the existing on-disk keyfile (if any) and the one that would be
+// written.
+func (c *Configurator) printDiff(files map[string]*ini.File) error {
+	destinations := make([]string, 0, len(files))
+	for destination := range files {
+		destinations = append(destinations, destination)
+	}
+	sort.Strings(destinations)
+
+	for _, destination := range destinations {
+		existing, err := ini.Load(destination)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("loading existing file %s: %w", destination, err)
+			}
+			existing = ini.Empty()
+		}
+
+		lines := diffINI(existing, files[destination])
+		if len(lines) == 0 {
+			log.Infof("%s: no changes", destination)
+			continue
+		}
+
+		log.Infof("%s:", destination)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
 	}
 
 	return nil
 }
 
-// Identify the preconfigured static host by matching the MAC address of at least one of the local network interfaces.
+// diffINI returns a sorted list of "-[section] key=value" / "+[section]
+// key=value" lines describing how new differs from old.
+func diffINI(old, new *ini.File) []string {
+	sections := map[string]bool{}
+	for _, s := range old.Sections() {
+		sections[s.Name()] = true
+	}
+	for _, s := range new.Sections() {
+		sections[s.Name()] = true
+	}
+
+	sectionNames := make([]string, 0, len(sections))
+	for name := range sections {
+		sectionNames = append(sectionNames, name)
+	}
+	sort.Strings(sectionNames)
+
+	var lines []string
+
+	for _, sectionName := range sectionNames {
+		oldSection := old.Section(sectionName)
+		newSection := new.Section(sectionName)
+
+		keys := map[string]bool{}
+		for _, k := range oldSection.Keys() {
+			keys[k.Name()] = true
+		}
+		for _, k := range newSection.Keys() {
+			keys[k.Name()] = true
+		}
+
+		keyNames := make([]string, 0, len(keys))
+		for name := range keys {
+			keyNames = append(keyNames, name)
+		}
+		sort.Strings(keyNames)
+
+		for _, keyName := range keyNames {
+			oldValue := oldSection.Key(keyName).Value()
+			newValue := newSection.Key(keyName).Value()
+			if oldValue == newValue {
+				continue
+			}
+
+			if oldValue != "" {
+				lines = append(lines, fmt.Sprintf("-[%s] %s=%s", sectionName, keyName, oldValue))
+			}
+			if newValue != "" {
+				lines = append(lines, fmt.Sprintf("+[%s] %s=%s", sectionName, keyName, newValue))
+			}
+		}
+	}
+
+	return lines
+}
+
+// applyConnections reloads NetworkManager's on-disk connections and
+// activates the connections that are either autoconnect-enabled or were
+// already active before this run, waiting for each to come up. Failures are
+// logged and aggregated per connection rather than aborting the batch.
+func (c *Configurator) applyConnections(files map[string]*ini.File) error {
+	client, err := nmclient.New()
+	if err != nil {
+		return fmt.Errorf("connecting to NetworkManager: %w", err)
+	}
+	defer client.Close()
+
+	if err = client.ReloadConnections(); err != nil {
+		return fmt.Errorf("reloading connections: %w", err)
+	}
+
+	activeUUIDs, err := client.ActiveConnectionUUIDs()
+	if err != nil {
+		log.Warnf("failed to read active connections, falling back to autoconnect only: %s", err)
+	}
+
+	active := make(map[string]bool, len(activeUUIDs))
+	for _, uuid := range activeUUIDs {
+		active[uuid] = true
+	}
+
+	var errs []error
+
+	for destination, file := range files {
+		conn := file.Section("connection")
+		uuid := conn.Key("uuid").String()
+		interfaceName := conn.Key("interface-name").String()
+		autoconnect := conn.Key("autoconnect").String() == "true"
+
+		if !autoconnect && !active[uuid] {
+			continue
+		}
+
+		log.Infof("activating connection %s (%s)...", interfaceName, uuid)
+		if err = client.ActivateConnection(context.Background(), uuid, interfaceName, activationTimeout); err != nil {
+			log.Errorf("failed to activate connection for %s: %s", destination, err)
+			errs = append(errs, fmt.Errorf("activating %s: %w", destination, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Identify the preconfigured static host with the highest matchScore against
+// the local network interfaces (by MAC address, PCI address, device path,
+// driver or port name) and DMI information, so hosts remain
+// identifiable even when MAC addresses are unstable or repeated across VFs.
 func (c *Configurator) identifyHost() (*config.Host, error) {
+	var best *config.Host
+	bestScore := 0
+
 	for _, host := range c.config.Hosts {
-		for _, i := range host.Interfaces {
-			if _, ok := c.networkInterfaces[i.MACAddress]; ok {
-				return host, nil
-			}
+		if score := c.matchScore(host); score > bestScore {
+			bestScore = score
+			best = host
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("none of the preconfigured hosts match local NICs")
+	}
+
+	return best, nil
+}
+
+// matchScore counts how many of a host's interfaces match a local NIC on at
+// least one selector, plus how many of its DMI selectors match the local DMI
+// information. An interface counts once however many of its selectors match.
+func (c *Configurator) matchScore(host *config.Host) int {
+	score := 0
+
+	for _, i := range host.Interfaces {
+		if _, ok := c.matchInterface(i); ok {
+			score++
+		}
+	}
+
+	if host.DMI != nil && c.localDMI != nil {
+		if host.DMI.SystemUUID != "" && strings.EqualFold(host.DMI.SystemUUID, c.localDMI.SystemUUID) {
+			score++
+		}
+		if host.DMI.ProductSerial != "" && strings.EqualFold(host.DMI.ProductSerial, c.localDMI.ProductSerial) {
+			score++
+		}
+		if host.DMI.ChassisAssetTag != "" && strings.EqualFold(host.DMI.ChassisAssetTag, c.localDMI.ChassisAssetTag) {
+			score++
+		}
+	}
+
+	return score
+}
+
+// matchInterface returns the local NIC whose selectors best match the given
+// preconfigured interface, and whether at least one selector matched.
+func (c *Configurator) matchInterface(i *config.Interface) (LocalNIC, bool) {
+	var best LocalNIC
+	bestMatches := 0
+
+	for _, nic := range c.networkInterfaces {
+		matches := 0
+
+		if i.MACAddress != "" && strings.EqualFold(nic.MAC, i.MACAddress) {
+			matches++
+		}
+		if i.PCIAddress != "" && strings.EqualFold(nic.PCIAddr, i.PCIAddress) {
+			matches++
+		}
+		if i.DevicePath != "" && nic.DevPath == i.DevicePath {
+			matches++
+		}
+		if i.Driver != "" && strings.EqualFold(nic.Driver, i.Driver) {
+			matches++
+		}
+		if i.PortName != "" && nic.Name == i.PortName {
+			matches++
+		}
+
+		if matches > bestMatches {
+			bestMatches = matches
+			best = nic
 		}
 	}
 
-	return nil, fmt.Errorf("none of the preconfigured hosts match local NICs")
+	return best, bestMatches > 0
 }
 
-// Copy all *.nmconnection files from the preconfigured host dir to the
-// appropriate NetworkManager dir (default "/etc/NetworkManager/system-connections").
-func (c *Configurator) copyConnectionFiles(host *config.Host) error {
+// prepareConnectionFiles loads all *.nmconnection files from the
+// preconfigured host dir, keyed by the destination path they should be
+// stored at in the NetworkManager dir (default
+// "/etc/NetworkManager/system-connections").
+func (c *Configurator) prepareConnectionFiles(host *config.Host) (map[string]*ini.File, error) {
 	hostConfigDir := filepath.Join(c.config.SourceDir, host.Name)
 	dirEntries, err := os.ReadDir(hostConfigDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var errs []error
+	files := make(map[string]*ini.File)
 
 	for _, entry := range dirEntries {
 		name := entry.Name()
@@ -86,16 +536,21 @@ func (c *Configurator) copyConnectionFiles(host *config.Host) error {
 		destination := filepath.Join(c.config.DestinationDir, name)
 		filename := strings.TrimSuffix(name, connectionFileExt)
 
-		// Update the name and all references of the host NIC in the settings file if there is a difference from the static config.
+		// Update the name and MAC address references of the host NIC in the settings file if there is a
+		// difference from the static config, using whichever selector actually resolved the physical port.
 		for _, i := range host.Interfaces {
 			if i.LogicalName != filename {
 				continue
 			}
 
-			interfaceName, ok := c.networkInterfaces[i.MACAddress]
-			if ok && interfaceName != i.LogicalName {
-				log.Debugf("using name '%s' for interface with MAC address '%s' instead of the preconfigured '%s'",
-					interfaceName, i.MACAddress, i.LogicalName)
+			nic, ok := c.matchInterface(i)
+			if !ok {
+				break
+			}
+
+			if nic.Name != i.LogicalName {
+				log.Debugf("using name '%s' for interface instead of the preconfigured '%s'",
+					nic.Name, i.LogicalName)
 
 				for _, section := range file.Sections() {
 					if !section.HasValue(i.LogicalName) {
@@ -104,27 +559,36 @@ func (c *Configurator) copyConnectionFiles(host *config.Host) error {
 
 					for _, key := range section.Keys() {
 						if key.Value() == i.LogicalName {
-							key.SetValue(interfaceName)
+							key.SetValue(nic.Name)
 						}
 					}
 				}
 
-				destination = fmt.Sprintf("%s/%s%s", c.config.DestinationDir, interfaceName, connectionFileExt)
+				destination = fmt.Sprintf("%s/%s%s", c.config.DestinationDir, nic.Name, connectionFileExt)
 			}
-			break
-		}
 
-		log.Infof("storing file %s...", destination)
-		if err = file.SaveTo(destination); err != nil {
-			errs = append(errs, fmt.Errorf("storing file %s: %w", destination, err))
-			continue
-		}
+			if nic.MAC != "" && i.MACAddress != "" && !strings.EqualFold(nic.MAC, i.MACAddress) {
+				log.Debugf("using MAC address '%s' for interface '%s' instead of the preconfigured '%s'",
+					nic.MAC, nic.Name, i.MACAddress)
 
-		// Set the necessary permissions required by NetworkManager.
-		if err = os.Chmod(destination, 0600); err != nil {
-			errs = append(errs, fmt.Errorf("updating permissions for file %s: %w", destination, err))
+				for _, section := range file.Sections() {
+					if !section.HasValue(i.MACAddress) {
+						continue
+					}
+
+					for _, key := range section.Keys() {
+						if strings.EqualFold(key.Value(), i.MACAddress) {
+							key.SetValue(nic.MAC)
+						}
+					}
+				}
+			}
+
+			break
 		}
+
+		files[destination] = file
 	}
 
-	return errors.Join(errs...)
+	return files, errors.Join(errs...)
 }
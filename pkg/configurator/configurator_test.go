@@ -2,6 +2,7 @@ package configurator
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,6 +23,9 @@ func TestConfigurator_Run(t *testing.T) {
 		conf            *config.Config
 		localInterfaces NetworkInterfaces
 		expectedErr     string
+		// expectedErrContains is used instead of expectedErr when the error
+		// embeds a non-deterministic temp filename.
+		expectedErrContains string
 	}{
 		{
 			name: "configurator fails due to none of the preconfigured hosts matching local interfaces",
@@ -47,8 +51,8 @@ func TestConfigurator_Run(t *testing.T) {
 					},
 				},
 			},
-			localInterfaces: map[string]string{
-				"00:10:20:30:40:50": "eth0",
+			localInterfaces: NetworkInterfaces{
+				{Name: "eth0", MAC: "00:10:20:30:40:50"},
 			},
 			expectedErr: "identifying host: none of the preconfigured hosts match local NICs",
 		},
@@ -68,8 +72,8 @@ func TestConfigurator_Run(t *testing.T) {
 					},
 				},
 			},
-			localInterfaces: map[string]string{
-				"00:11:22:33:44:55": "eth0",
+			localInterfaces: NetworkInterfaces{
+				{Name: "eth0", MAC: "00:11:22:33:44:55"},
 			},
 			expectedErr: "copying files: open some-non-existing-dir-123/host1: no such file or directory",
 		},
@@ -89,8 +93,8 @@ func TestConfigurator_Run(t *testing.T) {
 					},
 				},
 			},
-			localInterfaces: map[string]string{
-				"00:11:22:33:44:57": "eth0",
+			localInterfaces: NetworkInterfaces{
+				{Name: "eth0", MAC: "00:11:22:33:44:57"},
 			},
 			expectedErr: "copying files: loading file \"testdata/host2/invalid.nmconnection\": key-value delimiter not found: -[connection]\n",
 		},
@@ -111,10 +115,10 @@ func TestConfigurator_Run(t *testing.T) {
 					},
 				},
 			},
-			localInterfaces: map[string]string{
-				"00:11:22:33:44:57": "eth0",
+			localInterfaces: NetworkInterfaces{
+				{Name: "eth0", MAC: "00:11:22:33:44:57"},
 			},
-			expectedErr: "copying files: open some-non-existing-dir-123/eth0.nmconnection: no such file or directory",
+			expectedErrContains: "copying files: storing file some-non-existing-dir-123/eth0.nmconnection: open some-non-existing-dir-123/.nm-configurator-",
 		},
 		{
 			name: "configurator executed successfully",
@@ -133,8 +137,8 @@ func TestConfigurator_Run(t *testing.T) {
 					},
 				},
 			},
-			localInterfaces: map[string]string{
-				"00:11:22:33:44:55": "eth1",
+			localInterfaces: NetworkInterfaces{
+				{Name: "eth1", MAC: "00:11:22:33:44:55"},
 			},
 			expectedErr: "",
 		},
@@ -142,13 +146,20 @@ func TestConfigurator_Run(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			configurator := New(test.conf, test.localInterfaces)
+			configurator := New(test.conf, test.localInterfaces, nil)
 
-			err := configurator.Run()
+			err := configurator.Run(RunOptions{
+				LockFilePath:  filepath.Join(t.TempDir(), "nm-configurator.lock"),
+				BackupRootDir: t.TempDir(),
+			})
 
-			if test.expectedErr == "" {
+			switch {
+			case test.expectedErrContains != "":
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.expectedErrContains)
+			case test.expectedErr == "":
 				assert.Nil(t, err)
-			} else {
+			default:
 				assert.EqualError(t, err, test.expectedErr)
 			}
 		})
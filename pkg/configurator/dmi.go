@@ -0,0 +1,37 @@
+package configurator
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const dmiDir = "/sys/class/dmi/id"
+
+// DMIInfo holds the subset of the local system's DMI/SMBIOS information used
+// to identify a host independently of its network interfaces.
+type DMIInfo struct {
+	SystemUUID      string
+	ProductSerial   string
+	ChassisAssetTag string
+}
+
+// GetDMIInfo reads the local system's DMI information from sysfs. Fields
+// that cannot be read (missing permissions, not running on bare metal) are
+// left empty rather than failing the call.
+func GetDMIInfo() *DMIInfo {
+	return &DMIInfo{
+		SystemUUID:      readDMIField("product_uuid"),
+		ProductSerial:   readDMIField("product_serial"),
+		ChassisAssetTag: readDMIField("chassis_asset_tag"),
+	}
+}
+
+func readDMIField(name string) string {
+	data, err := os.ReadFile(filepath.Join(dmiDir, name))
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,47 @@
+package configurator
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultLockFilePath is acquired for the duration of any mutating Run
+// invocation so overlapping invocations (e.g. a systemd unit and a manual
+// run) serialize instead of racing on the destination dir. Overridable via
+// RunOptions.LockFilePath, primarily so tests can point it at a tempdir
+// instead of requiring a writable "/run".
+const defaultLockFilePath = "/run/nm-configurator.lock"
+
+// fileLock is an exclusive flock(2) held on path.
+type fileLock struct {
+	file *os.File
+	path string
+}
+
+// acquireLock opens (creating if necessary) and exclusively locks path,
+// blocking until it is available.
+func acquireLock(path string) (*fileLock, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file %s: %w", path, err)
+	}
+
+	if err = unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("acquiring lock on %s: %w", path, err)
+	}
+
+	return &fileLock{file: file, path: path}, nil
+}
+
+// release unlocks and closes the lock file.
+func (l *fileLock) release() error {
+	if err := unix.Flock(int(l.file.Fd()), unix.LOCK_UN); err != nil {
+		_ = l.file.Close()
+		return fmt.Errorf("releasing lock on %s: %w", l.path, err)
+	}
+
+	return l.file.Close()
+}
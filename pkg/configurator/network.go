@@ -2,14 +2,27 @@ package configurator
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
-// NetworkInterfaces maps system network interfaces.
-//
-// Key is MAC Address.
-// Value is Name.
-type NetworkInterfaces map[string]string
+// LocalNIC describes a network interface found on the local system,
+// along with the selectors that can be used to identify it
+// regardless of its current kernel-assigned name or MAC address.
+type LocalNIC struct {
+	Name    string
+	MAC     string
+	PCIAddr string
+	DevPath string
+	Driver  string
+}
+
+// NetworkInterfaces is the set of network interfaces with a hardware address
+// found on the local system, virtual ones included.
+type NetworkInterfaces []LocalNIC
+
+const sysClassNetDir = "/sys/class/net"
 
 func GetNetworkInterfaces() (NetworkInterfaces, error) {
 	interfaces, err := net.Interfaces()
@@ -17,7 +30,7 @@ func GetNetworkInterfaces() (NetworkInterfaces, error) {
 		return nil, err
 	}
 
-	interfaceAddresses := map[string]string{}
+	var nics NetworkInterfaces
 
 	for _, i := range interfaces {
 		if i.HardwareAddr == nil {
@@ -25,9 +38,40 @@ func GetNetworkInterfaces() (NetworkInterfaces, error) {
 			continue
 		}
 
-		address := strings.ToLower(i.HardwareAddr.String())
-		interfaceAddresses[address] = i.Name
+		devPath, pciAddr, driver := readDeviceInfo(i.Name)
+
+		nics = append(nics, LocalNIC{
+			Name:    i.Name,
+			MAC:     strings.ToLower(i.HardwareAddr.String()),
+			PCIAddr: pciAddr,
+			DevPath: devPath,
+			Driver:  driver,
+		})
+	}
+
+	return nics, nil
+}
+
+// readDeviceInfo resolves the "/sys/class/net/<name>/device" symlink of a
+// local interface to discover its topological device path, PCI address and
+// driver. devPath is the fully resolved symlink target (e.g.
+// "/sys/devices/pci0000:00/0000:00:1f.6/..."), not the "/sys/class/net/..."
+// link itself, so it identifies the physical port rather than just
+// re-encoding the interface's current kernel name. Any field that cannot be
+// resolved (e.g. virtual interfaces without a backing device) is left empty.
+func readDeviceInfo(name string) (devPath, pciAddr, driver string) {
+	link := filepath.Join(sysClassNetDir, name, "device")
+
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return "", "", ""
+	}
+	devPath = resolved
+	pciAddr = filepath.Base(resolved)
+
+	if target, err := os.Readlink(filepath.Join(resolved, "driver")); err == nil {
+		driver = filepath.Base(target)
 	}
 
-	return interfaceAddresses, nil
+	return devPath, pciAddr, driver
 }
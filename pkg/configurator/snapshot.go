@@ -0,0 +1,124 @@
+package configurator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultBackupRootDir stores timestamped snapshots of the destination dir,
+// taken before it is mutated, so a failed batch (or an explicit --rollback)
+// can restore the previous *.nmconnection files. Overridable via
+// RunOptions.BackupRootDir, primarily so tests can point it at a tempdir
+// instead of requiring a writable "/var/lib".
+const defaultBackupRootDir = "/var/lib/nm-configurator/backup"
+
+// snapshotDestinationDir copies every existing *.nmconnection file out of
+// destinationDir into a new timestamped backup dir under backupRootDir,
+// returning its path. It returns an empty path (and no error) if
+// destinationDir does not exist yet.
+func snapshotDestinationDir(destinationDir, backupRootDir string) (string, error) {
+	entries, err := os.ReadDir(destinationDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	backupDir := filepath.Join(backupRootDir, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err = os.MkdirAll(backupDir, 0700); err != nil {
+		return "", fmt.Errorf("creating backup dir %s: %w", backupDir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != connectionFileExt {
+			continue
+		}
+
+		source := filepath.Join(destinationDir, entry.Name())
+		destination := filepath.Join(backupDir, entry.Name())
+		if err = copyFile(source, destination); err != nil {
+			return "", fmt.Errorf("backing up %s: %w", source, err)
+		}
+	}
+
+	return backupDir, nil
+}
+
+// restoreSnapshot replaces destinationDir's *.nmconnection files with the
+// ones stored in backupDir, removing any file that was written since the
+// snapshot was taken but did not exist in it.
+func restoreSnapshot(destinationDir, backupDir string) error {
+	current, err := os.ReadDir(destinationDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, entry := range current {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != connectionFileExt {
+			continue
+		}
+
+		if _, err = os.Stat(filepath.Join(backupDir, entry.Name())); os.IsNotExist(err) {
+			if err = os.Remove(filepath.Join(destinationDir, entry.Name())); err != nil {
+				return fmt.Errorf("removing %s: %w", entry.Name(), err)
+			}
+		}
+	}
+
+	backupEntries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return fmt.Errorf("reading backup dir %s: %w", backupDir, err)
+	}
+
+	if err = os.MkdirAll(destinationDir, 0755); err != nil {
+		return fmt.Errorf("creating destination dir %s: %w", destinationDir, err)
+	}
+
+	for _, entry := range backupEntries {
+		destination := filepath.Join(destinationDir, entry.Name())
+		if err = copyFile(filepath.Join(backupDir, entry.Name()), destination); err != nil {
+			return fmt.Errorf("restoring %s: %w", entry.Name(), err)
+		}
+
+		if err = os.Chmod(destination, 0600); err != nil {
+			return fmt.Errorf("updating permissions for %s: %w", destination, err)
+		}
+	}
+
+	return nil
+}
+
+// newestSnapshot returns the path to the most recently taken backup under
+// backupRootDir, relying on the lexically sortable timestamp format used by
+// snapshotDestinationDir.
+func newestSnapshot(backupRootDir string) (string, error) {
+	entries, err := os.ReadDir(backupRootDir)
+	if err != nil {
+		return "", fmt.Errorf("reading backup dir %s: %w", backupRootDir, err)
+	}
+
+	var newest string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() > newest {
+			newest = entry.Name()
+		}
+	}
+
+	if newest == "" {
+		return "", fmt.Errorf("no backups found in %s", backupRootDir)
+	}
+
+	return filepath.Join(backupRootDir, newest), nil
+}
+
+func copyFile(source, destination string) error {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(destination, data, 0600)
+}
@@ -0,0 +1,193 @@
+package configurator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suse-edge/nm-configurator/pkg/config"
+)
+
+// defaultVerifyTimeout bounds how long health checks are retried when a
+// host's VerifyConfig does not set one explicitly.
+const defaultVerifyTimeout = 30 * time.Second
+
+const checkRetryInterval = time.Second
+
+// runHealthChecks runs host's configured post-apply health checks, retrying
+// each until it passes or the configured timeout elapses. It evaluates every
+// check rather than stopping at the first failure, so the returned error
+// (if any) describes the complete picture.
+func (c *Configurator) runHealthChecks(host *config.Host) error {
+	verify := host.Verify
+	if verify == nil {
+		return nil
+	}
+
+	timeout := defaultVerifyTimeout
+	if verify.Timeout != "" {
+		d, err := time.ParseDuration(verify.Timeout)
+		if err != nil {
+			return fmt.Errorf("parsing verify timeout: %w", err)
+		}
+		timeout = d
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	var errs []error
+
+	if verify.DefaultRouteInterface != "" {
+		if err := retryUntil(deadline, func() error { return checkDefaultRoute(verify.DefaultRouteInterface) }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if verify.DNSHostname != "" {
+		if err := retryUntil(deadline, func() error { return checkDNS(verify.DNSHostname) }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, target := range verify.Targets {
+		target := target
+		if err := retryUntil(deadline, func() error { return checkTarget(target) }); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// retryUntil retries check every checkRetryInterval until it succeeds or
+// deadline passes, returning the last error.
+func retryUntil(deadline time.Time, check func() error) error {
+	var lastErr error
+
+	for {
+		if lastErr = check(); lastErr == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return lastErr
+		}
+
+		time.Sleep(checkRetryInterval)
+	}
+}
+
+// checkDefaultRoute verifies that an IPv4 or IPv6 default route goes out
+// through expectedIface, reading "/proc/net/route" and
+// "/proc/net/ipv6_route" so the check doesn't misfire on an IPv6-only
+// management link.
+func checkDefaultRoute(expectedIface string) error {
+	v4, v4Err := defaultRouteInterfacesV4()
+	v6, v6Err := defaultRouteInterfacesV6()
+	if v4Err != nil && v6Err != nil {
+		return fmt.Errorf("reading default routes: %w", errors.Join(v4Err, v6Err))
+	}
+
+	found := append(v4, v6...)
+	for _, iface := range found {
+		if iface == expectedIface {
+			return nil
+		}
+	}
+
+	if len(found) > 0 {
+		return fmt.Errorf("default route is on interface(s) %q, expected %q", found, expectedIface)
+	}
+
+	return fmt.Errorf("no default route found")
+}
+
+// defaultRouteInterfacesV4 returns the interfaces carrying an IPv4 default
+// route (destination 0.0.0.0), read from "/proc/net/route".
+func defaultRouteInterfacesV4() ([]string, error) {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("reading /proc/net/route: %w", err)
+	}
+
+	var ifaces []string
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		if fields[1] == "00000000" { // destination 0.0.0.0
+			ifaces = append(ifaces, fields[0])
+		}
+	}
+
+	return ifaces, nil
+}
+
+// defaultRouteInterfacesV6 returns the interfaces carrying an IPv6 default
+// route (destination ::/0), read from "/proc/net/ipv6_route". It returns no
+// interfaces (and no error) if the file is absent, e.g. on a host with IPv6
+// disabled.
+func defaultRouteInterfacesV6() ([]string, error) {
+	data, err := os.ReadFile("/proc/net/ipv6_route")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading /proc/net/ipv6_route: %w", err)
+	}
+
+	var ifaces []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+
+		// destination ::/0
+		if fields[0] == strings.Repeat("0", 32) && fields[1] == "00" {
+			ifaces = append(ifaces, fields[9])
+		}
+	}
+
+	return ifaces, nil
+}
+
+// checkDNS verifies that hostname resolves.
+func checkDNS(hostname string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, hostname); err != nil {
+		return fmt.Errorf("resolving %s: %w", hostname, err)
+	}
+
+	return nil
+}
+
+// checkTarget performs a single reachability check against target.
+func checkTarget(target config.VerifyTarget) error {
+	switch target.Type {
+	case "tcp":
+		address := net.JoinHostPort(target.Address, strconv.Itoa(target.Port))
+		conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+		if err != nil {
+			return fmt.Errorf("connecting to %s: %w", address, err)
+		}
+		return conn.Close()
+	case "ping":
+		if err := exec.Command("ping", "-c", "1", "-W", "2", target.Address).Run(); err != nil {
+			return fmt.Errorf("pinging %s: %w", target.Address, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported verify target type %q", target.Type)
+	}
+}
@@ -0,0 +1,245 @@
+// Package nmclient talks to NetworkManager over its system D-Bus API, so
+// keyfiles written to "/etc/NetworkManager/system-connections" can be
+// reloaded and activated without shelling out to nmcli.
+package nmclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	destination = "org.freedesktop.NetworkManager"
+
+	rootPath        = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+	rootIface       = "org.freedesktop.NetworkManager"
+	settingsPath    = dbus.ObjectPath("/org/freedesktop/NetworkManager/Settings")
+	settingsIface   = "org.freedesktop.NetworkManager.Settings"
+	connectionIface = "org.freedesktop.NetworkManager.Settings.Connection"
+	deviceIface     = "org.freedesktop.NetworkManager.Device"
+	activeConnIface = "org.freedesktop.NetworkManager.Connection.Active"
+)
+
+// DeviceState mirrors the subset of NMDeviceState values relevant to
+// activation. See the NetworkManager D-Bus API reference for the full list.
+type DeviceState uint32
+
+const (
+	DeviceStateUnknown   DeviceState = 0
+	DeviceStateActivated DeviceState = 100
+	DeviceStateFailed    DeviceState = 120
+)
+
+// Client is a thin wrapper around the NetworkManager system D-Bus API.
+type Client struct {
+	conn *dbus.Conn
+}
+
+// New connects to the system bus and returns a Client talking to
+// NetworkManager.
+func New() (*Client, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to system bus: %w", err)
+	}
+
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the underlying D-Bus connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// ReloadConnections tells NetworkManager to re-read all connection files
+// from disk.
+func (c *Client) ReloadConnections() error {
+	var ok bool
+	obj := c.conn.Object(destination, settingsPath)
+	return obj.Call(settingsIface+".ReloadConnections", 0).Store(&ok)
+}
+
+// ActiveConnectionUUIDs returns the UUIDs of all currently active connections.
+func (c *Client) ActiveConnectionUUIDs() ([]string, error) {
+	nm := c.conn.Object(destination, rootPath)
+
+	v, err := nm.GetProperty(rootIface + ".ActiveConnections")
+	if err != nil {
+		return nil, fmt.Errorf("reading active connections: %w", err)
+	}
+
+	paths, ok := v.Value().([]dbus.ObjectPath)
+	if !ok {
+		return nil, fmt.Errorf("unexpected ActiveConnections property type %T", v.Value())
+	}
+
+	uuids := make([]string, 0, len(paths))
+	for _, p := range paths {
+		active := c.conn.Object(destination, p)
+
+		uv, err := active.GetProperty(activeConnIface + ".Uuid")
+		if err != nil {
+			continue
+		}
+		if uuid, ok := uv.Value().(string); ok {
+			uuids = append(uuids, uuid)
+		}
+	}
+
+	return uuids, nil
+}
+
+// ActivateConnection activates the connection identified by uuid on the
+// device named deviceName, waiting up to timeout for the device to reach the
+// "activated" state.
+func (c *Client) ActivateConnection(ctx context.Context, uuid, deviceName string, timeout time.Duration) error {
+	connPath, err := c.findConnectionPath(uuid)
+	if err != nil {
+		return err
+	}
+
+	devPath, err := c.findDevicePath(deviceName)
+	if err != nil {
+		return err
+	}
+
+	nm := c.conn.Object(destination, rootPath)
+
+	var activePath dbus.ObjectPath
+	if err = nm.Call(rootIface+".ActivateConnection", 0, connPath, devPath, dbus.ObjectPath("/")).Store(&activePath); err != nil {
+		return fmt.Errorf("activating connection %s: %w", uuid, err)
+	}
+
+	return c.waitForDeviceState(ctx, devPath, DeviceStateActivated, timeout)
+}
+
+// DeactivateConnection deactivates the active connection identified by uuid.
+// It is a no-op if the connection is not currently active.
+func (c *Client) DeactivateConnection(uuid string) error {
+	nm := c.conn.Object(destination, rootPath)
+
+	v, err := nm.GetProperty(rootIface + ".ActiveConnections")
+	if err != nil {
+		return fmt.Errorf("reading active connections: %w", err)
+	}
+
+	paths, ok := v.Value().([]dbus.ObjectPath)
+	if !ok {
+		return fmt.Errorf("unexpected ActiveConnections property type %T", v.Value())
+	}
+
+	for _, p := range paths {
+		active := c.conn.Object(destination, p)
+
+		uv, err := active.GetProperty(activeConnIface + ".Uuid")
+		if err != nil {
+			continue
+		}
+		if uuid2, ok := uv.Value().(string); ok && uuid2 == uuid {
+			return nm.Call(rootIface+".DeactivateConnection", 0, p).Err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) findConnectionPath(uuid string) (dbus.ObjectPath, error) {
+	settings := c.conn.Object(destination, settingsPath)
+
+	var conns []dbus.ObjectPath
+	if err := settings.Call(settingsIface+".ListConnections", 0).Store(&conns); err != nil {
+		return "", fmt.Errorf("listing connections: %w", err)
+	}
+
+	for _, p := range conns {
+		conn := c.conn.Object(destination, p)
+
+		var settingsMap map[string]map[string]dbus.Variant
+		if err := conn.Call(connectionIface+".GetSettings", 0).Store(&settingsMap); err != nil {
+			continue
+		}
+
+		if id, ok := settingsMap["connection"]["uuid"].Value().(string); ok && id == uuid {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("connection with uuid %s not found", uuid)
+}
+
+func (c *Client) findDevicePath(name string) (dbus.ObjectPath, error) {
+	nm := c.conn.Object(destination, rootPath)
+
+	var devPath dbus.ObjectPath
+	if err := nm.Call(rootIface+".GetDeviceByIpIface", 0, name).Store(&devPath); err != nil {
+		return "", fmt.Errorf("finding device %s: %w", name, err)
+	}
+
+	return devPath, nil
+}
+
+func (c *Client) deviceState(devPath dbus.ObjectPath) (DeviceState, error) {
+	dev := c.conn.Object(destination, devPath)
+
+	v, err := dev.GetProperty(deviceIface + ".State")
+	if err != nil {
+		return DeviceStateUnknown, err
+	}
+
+	state, ok := v.Value().(uint32)
+	if !ok {
+		return DeviceStateUnknown, fmt.Errorf("unexpected State property type %T", v.Value())
+	}
+
+	return DeviceState(state), nil
+}
+
+// waitForDeviceState blocks, subscribing to the device's StateChanged
+// signal, until it reaches want or timeout elapses. It returns an error early
+// if the device enters the failed state.
+func (c *Client) waitForDeviceState(ctx context.Context, devPath dbus.ObjectPath, want DeviceState, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Subscribe before taking the initial state reading, so a transition
+	// landing between the read and the subscription is not missed.
+	signals := make(chan *dbus.Signal, 16)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	matchRule := fmt.Sprintf("type='signal',interface='%s',member='StateChanged',path='%s'", deviceIface, devPath)
+	if err := c.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, matchRule).Err; err != nil {
+		return fmt.Errorf("subscribing to device state changes: %w", err)
+	}
+	defer c.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, matchRule)
+
+	if state, err := c.deviceState(devPath); err == nil && state == want {
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for device %s to reach state %d", devPath, want)
+		case sig := <-signals:
+			if sig.Path != devPath || sig.Name != deviceIface+".StateChanged" || len(sig.Body) == 0 {
+				continue
+			}
+
+			newState, ok := sig.Body[0].(uint32)
+			if !ok {
+				continue
+			}
+
+			switch DeviceState(newState) {
+			case want:
+				return nil
+			case DeviceStateFailed:
+				return fmt.Errorf("device %s activation failed", devPath)
+			}
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// Package renderer turns a declarative, nmstate-style config.NetworkState
+// document into the *.nmconnection keyfiles NetworkManager expects, so an
+// operator can provide a single desired-state document instead of
+// hand-authored keyfiles per host.
+package renderer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/suse-edge/nm-configurator/pkg/config"
+	"gopkg.in/ini.v1"
+)
+
+// connectionFileNamespace is a fixed namespace used to derive deterministic
+// connection UUIDs from "<hostname>/<logical-name>", so re-rendering the same
+// desired state for the same host always produces the same UUIDs.
+var connectionFileNamespace = uuid.MustParse("b60f48b0-7e29-4b92-9c3e-7e6f6b9e1a4e")
+
+// connectionUUID deterministically derives a connection UUID from the host
+// name and the interface's logical name.
+func connectionUUID(hostName, interfaceName string) string {
+	return uuid.NewSHA1(connectionFileNamespace, []byte(hostName+"/"+interfaceName)).String()
+}
+
+// port describes the master interface that owns a bond/bridge port, along
+// with the "slave-type" NetworkManager expects for that kind of master.
+type port struct {
+	masterName string
+	slaveType  string
+}
+
+// Render turns the desired state document of a host into one *.nmconnection
+// ini.File per interface, keyed by filename (e.g. "eth0.nmconnection").
+func Render(hostName string, state *config.NetworkState) (map[string]*ini.File, error) {
+	ports := collectPorts(state)
+
+	files := make(map[string]*ini.File, len(state.Interfaces))
+
+	for _, iface := range state.Interfaces {
+		file := ini.Empty()
+
+		if err := renderConnectionSection(file, hostName, iface, ports[iface.Name]); err != nil {
+			return nil, fmt.Errorf("rendering interface %s: %w", iface.Name, err)
+		}
+
+		if err := renderTypeSection(file, iface); err != nil {
+			return nil, fmt.Errorf("rendering interface %s: %w", iface.Name, err)
+		}
+
+		if err := renderIPSection(file, "ipv4", iface.IPv4); err != nil {
+			return nil, fmt.Errorf("rendering interface %s: %w", iface.Name, err)
+		}
+
+		if err := renderIPSection(file, "ipv6", iface.IPv6); err != nil {
+			return nil, fmt.Errorf("rendering interface %s: %w", iface.Name, err)
+		}
+
+		files[iface.Name+".nmconnection"] = file
+	}
+
+	return files, nil
+}
+
+// collectPorts returns, for every interface referenced as a bond or bridge
+// port, the name and slave-type of the owning master interface.
+func collectPorts(state *config.NetworkState) map[string]port {
+	ports := map[string]port{}
+
+	for _, iface := range state.Interfaces {
+		switch {
+		case iface.LinkAggregation != nil:
+			for _, name := range iface.LinkAggregation.Port {
+				ports[name] = port{masterName: iface.Name, slaveType: "bond"}
+			}
+		case iface.Bridge != nil:
+			for _, p := range iface.Bridge.Port {
+				ports[p.Name] = port{masterName: iface.Name, slaveType: "bridge"}
+			}
+		}
+	}
+
+	return ports
+}
+
+func connectionType(t config.InterfaceType) (string, error) {
+	switch t {
+	case config.InterfaceTypeEthernet:
+		return "802-3-ethernet", nil
+	case config.InterfaceTypeVlan:
+		return "vlan", nil
+	case config.InterfaceTypeBond:
+		return "bond", nil
+	case config.InterfaceTypeBridge:
+		return "bridge", nil
+	case config.InterfaceTypeOVSBridge:
+		return "ovs-bridge", nil
+	default:
+		return "", fmt.Errorf("unsupported interface type %q", t)
+	}
+}
+
+func renderConnectionSection(file *ini.File, hostName string, iface *config.DesiredInterface, p port) error {
+	connType, err := connectionType(iface.Type)
+	if err != nil {
+		return err
+	}
+
+	section := file.Section("connection")
+	_, _ = section.NewKey("id", iface.Name)
+	_, _ = section.NewKey("uuid", connectionUUID(hostName, iface.Name))
+	_, _ = section.NewKey("type", connType)
+	_, _ = section.NewKey("interface-name", iface.Name)
+	_, _ = section.NewKey("autoconnect", "true")
+
+	if p.masterName != "" {
+		_, _ = section.NewKey("master", p.masterName)
+		_, _ = section.NewKey("slave-type", p.slaveType)
+	}
+
+	return nil
+}
+
+func renderTypeSection(file *ini.File, iface *config.DesiredInterface) error {
+	switch iface.Type {
+	case config.InterfaceTypeEthernet:
+		section := file.Section("ethernet")
+		if iface.MACAddress != "" {
+			_, _ = section.NewKey("mac-address", iface.MACAddress)
+		}
+	case config.InterfaceTypeVlan:
+		if iface.Vlan == nil {
+			return fmt.Errorf("interface %s is of type vlan but has no vlan block", iface.Name)
+		}
+		section := file.Section("vlan")
+		_, _ = section.NewKey("id", fmt.Sprintf("%d", iface.Vlan.ID))
+		_, _ = section.NewKey("parent", iface.Vlan.BaseIface)
+	case config.InterfaceTypeBond:
+		if iface.LinkAggregation == nil {
+			return fmt.Errorf("interface %s is of type bond but has no link-aggregation block", iface.Name)
+		}
+		section := file.Section("bond")
+		_, _ = section.NewKey("mode", iface.LinkAggregation.Mode)
+
+		optionNames := make([]string, 0, len(iface.LinkAggregation.Options))
+		for name := range iface.LinkAggregation.Options {
+			optionNames = append(optionNames, name)
+		}
+		sort.Strings(optionNames)
+		for _, name := range optionNames {
+			_, _ = section.NewKey(name, iface.LinkAggregation.Options[name])
+		}
+	case config.InterfaceTypeBridge:
+		file.Section("bridge")
+	case config.InterfaceTypeOVSBridge:
+		file.Section("ovs-bridge")
+	}
+
+	return nil
+}
+
+func renderIPSection(file *ini.File, name string, ip *config.IPConfig) error {
+	section := file.Section(name)
+
+	if ip == nil || !ip.Enabled {
+		_, _ = section.NewKey("method", "disabled")
+		return nil
+	}
+
+	if ip.DHCP {
+		_, _ = section.NewKey("method", "auto")
+		return nil
+	}
+
+	_, _ = section.NewKey("method", "manual")
+	for i, addr := range ip.Address {
+		_, _ = section.NewKey(fmt.Sprintf("address%d", i+1), fmt.Sprintf("%s/%d", addr.IP, addr.PrefixLength))
+	}
+
+	return nil
+}
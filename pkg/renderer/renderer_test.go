@@ -0,0 +1,78 @@
+package renderer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/suse-edge/nm-configurator/pkg/config"
+)
+
+func TestRender(t *testing.T) {
+	state := &config.NetworkState{
+		Interfaces: []*config.DesiredInterface{
+			{
+				Name: "bond0",
+				Type: config.InterfaceTypeBond,
+				LinkAggregation: &config.LinkAggregation{
+					Mode:    "active-backup",
+					Port:    []string{"eth0", "eth1"},
+					Options: map[string]string{"miimon": "100"},
+				},
+				IPv4: &config.IPConfig{
+					Enabled: true,
+					Address: []config.IPAddress{
+						{IP: "192.168.1.10", PrefixLength: 24},
+					},
+				},
+			},
+			{
+				Name:       "eth0",
+				Type:       config.InterfaceTypeEthernet,
+				MACAddress: "00:11:22:33:44:55",
+			},
+			{
+				Name: "eth1",
+				Type: config.InterfaceTypeEthernet,
+			},
+			{
+				Name: "bond0.100",
+				Type: config.InterfaceTypeVlan,
+				Vlan: &config.VlanConfig{
+					ID:        100,
+					BaseIface: "bond0",
+				},
+				IPv4: &config.IPConfig{Enabled: true, DHCP: true},
+			},
+		},
+	}
+
+	files, err := Render("node1.example.com", state)
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+
+	bond0 := files["bond0.nmconnection"]
+	require.NotNil(t, bond0)
+	assert.Equal(t, "bond", bond0.Section("connection").Key("type").String())
+	assert.Equal(t, "active-backup", bond0.Section("bond").Key("mode").String())
+	assert.Equal(t, "100", bond0.Section("bond").Key("miimon").String())
+	assert.Equal(t, "manual", bond0.Section("ipv4").Key("method").String())
+	assert.Equal(t, "192.168.1.10/24", bond0.Section("ipv4").Key("address1").String())
+
+	eth0 := files["eth0.nmconnection"]
+	require.NotNil(t, eth0)
+	assert.Equal(t, "bond0", eth0.Section("connection").Key("master").String())
+	assert.Equal(t, "bond", eth0.Section("connection").Key("slave-type").String())
+	assert.Equal(t, "00:11:22:33:44:55", eth0.Section("ethernet").Key("mac-address").String())
+
+	vlan := files["bond0.100.nmconnection"]
+	require.NotNil(t, vlan)
+	assert.Equal(t, "100", vlan.Section("vlan").Key("id").String())
+	assert.Equal(t, "bond0", vlan.Section("vlan").Key("parent").String())
+	assert.Equal(t, "auto", vlan.Section("ipv4").Key("method").String())
+
+	// UUIDs must be deterministic across re-renders for the same host.
+	again, err := Render("node1.example.com", state)
+	require.NoError(t, err)
+	assert.Equal(t, bond0.Section("connection").Key("uuid").String(), again["bond0.nmconnection"].Section("connection").Key("uuid").String())
+}